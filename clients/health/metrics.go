@@ -0,0 +1,48 @@
+package health
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// Registry is the default Prometheus registry collectors are registered
+// against when no per-Service registry is configured via WithRegistry.
+var Registry = prometheus.NewRegistry()
+
+// RegisterCollector registers a collector against Registry. A collector that
+// is already registered is silently ignored, and any other registration error
+// is logged rather than returned - callers are not expected to track whether
+// a given instrumentation point has already wired itself up.
+func RegisterCollector(collector prometheus.Collector) {
+	RegisterCollectorTo(Registry, collector)
+}
+
+// RegisterCollectorTo registers a collector against registry, silently
+// ignoring one that is already registered and logging any other registration
+// error rather than returning it. Use this instead of
+// RegisterCollector when the collector belongs to a component (e.g. a
+// registry.Listener) that was configured with its own *prometheus.Registry
+// via WithRegistry, rather than the package-level Registry.
+func RegisterCollectorTo(registry *prometheus.Registry, collector prometheus.Collector) {
+	if err := registry.Register(collector); err != nil {
+		if _, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return
+		}
+		log.WithError(err).Warn("failed to register prometheus collector")
+	}
+}
+
+// MakeMetricsHandler returns an HTTP handler serving registry in the
+// Prometheus text exposition format.
+func MakeMetricsHandler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// HandleMetrics registers a Prometheus /metrics endpoint for registry on
+// http.DefaultServeMux, alongside /health.
+func HandleMetrics(registry *prometheus.Registry) {
+	http.Handle("/metrics", MakeMetricsHandler(registry))
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"net/http"
 
-	"forta-protocol/forta-core-go/config"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+
+	"forta-protocol/forta-core-go/config"
 )
 
 // HealthChecker checks service health and generates reports.
@@ -44,9 +46,19 @@ func CheckerFrom(summarizer Summarizer, reporters ...Reporter) HealthChecker {
 	}
 }
 
-// StartServer starts the health check server to receive and handle incoming health check requests.
+// StartServer starts the health check server to receive and handle incoming
+// health check requests, and mounts a Prometheus /metrics endpoint on the
+// same port so the binary has a single scrape target for both.
 func StartServer(ctx context.Context, healthChecker HealthChecker) {
+	StartServerWithRegistry(ctx, healthChecker, Registry)
+}
+
+// StartServerWithRegistry is StartServer, but serves registry at /metrics
+// instead of the package-level Registry. Used by Service when configured with
+// WithRegistry.
+func StartServerWithRegistry(ctx context.Context, healthChecker HealthChecker, registry *prometheus.Registry) {
 	Handle(healthChecker)
+	HandleMetrics(registry)
 	server := &http.Server{
 		Addr: fmt.Sprintf(":%s", config.DefaultHealthPort),
 	}
@@ -81,16 +93,34 @@ func Handle(healthChecker HealthChecker) {
 type Service struct {
 	ctx           context.Context
 	healthChecker HealthChecker
+	registry      *prometheus.Registry
+}
+
+// ServiceOption configures optional behavior on a Service.
+type ServiceOption func(*Service)
+
+// WithRegistry serves registry at /metrics instead of the package-level
+// Registry. Useful when a consumer already maintains its own
+// *prometheus.Registry and wants this service to expose it rather than a
+// second one.
+func WithRegistry(registry *prometheus.Registry) ServiceOption {
+	return func(service *Service) {
+		service.registry = registry
+	}
 }
 
 // NewService creates a new service.
-func NewService(ctx context.Context, healthChecker HealthChecker) *Service {
-	return &Service{ctx: ctx, healthChecker: healthChecker}
+func NewService(ctx context.Context, healthChecker HealthChecker, opts ...ServiceOption) *Service {
+	service := &Service{ctx: ctx, healthChecker: healthChecker, registry: Registry}
+	for _, opt := range opts {
+		opt(service)
+	}
+	return service
 }
 
 // Start starts a service.
 func (service *Service) Start() error {
-	StartServer(service.ctx, service.healthChecker)
+	StartServerWithRegistry(service.ctx, service.healthChecker, service.registry)
 	return nil
 }
 
@@ -17,6 +17,9 @@ type AgentMessage struct {
 	Message
 	AgentID string `json:"agentId"`
 	TxHash  string `json:"txHash"`
+	// Replayed is true when this message was reconstructed from a
+	// registry.Snapshotter snapshot rather than observed live.
+	Replayed bool `json:"replayed,omitempty"`
 }
 
 type AgentSaveMessage struct {
@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"github.com/goccy/go-json"
+
+	"github.com/forta-protocol/forta-core-go/contracts/contract_dispatch"
+	"github.com/forta-protocol/forta-core-go/utils"
+)
+
+var Link = "Link"
+
+type DispatchMessage struct {
+	Message
+	AgentID   string `json:"agentId"`
+	ScannerID string `json:"scannerId"`
+	TxHash    string `json:"txHash"`
+	// Replayed is true when this message was reconstructed from a
+	// registry.Snapshotter snapshot rather than observed live.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+func ParseDispatchMessage(msg string) (*DispatchMessage, error) {
+	var m DispatchMessage
+	err := json.Unmarshal([]byte(msg), &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func NewDispatchMessage(evt *contract_dispatch.DispatchLink) *DispatchMessage {
+	return &DispatchMessage{
+		Message: Message{
+			Action: Link,
+		},
+		AgentID:   utils.Hex(evt.AgentId),
+		ScannerID: utils.Hex(evt.ScannerId),
+		TxHash:    evt.Raw.TxHash.Hex(),
+	}
+}
@@ -0,0 +1,38 @@
+package registry
+
+// Revert* actions mark a message as a compensating rollback for a previously
+// delivered registry event whose originating block turned out to be
+// non-canonical after its events were already promoted (i.e. a reorg reached
+// back past the finality check).
+var (
+	RevertSaveAgent   = "RevertSaveAgent"
+	RevertSaveScanner = "RevertSaveScanner"
+	RevertDispatch    = "RevertDispatch"
+)
+
+// NewRevertAgentSaveMessage builds a compensating message for an AgentSaveMessage
+// that was already surfaced to handlers before its block was found to be
+// non-canonical.
+func NewRevertAgentSaveMessage(original *AgentSaveMessage) *AgentSaveMessage {
+	reverted := *original
+	reverted.Action = RevertSaveAgent
+	return &reverted
+}
+
+// NewRevertScannerSaveMessage builds a compensating message for a ScannerSaveMessage
+// that was already surfaced to handlers before its block was found to be
+// non-canonical.
+func NewRevertScannerSaveMessage(original *ScannerSaveMessage) *ScannerSaveMessage {
+	reverted := *original
+	reverted.Action = RevertSaveScanner
+	return &reverted
+}
+
+// NewRevertDispatchMessage builds a compensating message for a DispatchMessage
+// that was already surfaced to handlers before its block was found to be
+// non-canonical.
+func NewRevertDispatchMessage(original *DispatchMessage) *DispatchMessage {
+	reverted := *original
+	reverted.Action = RevertDispatch
+	return &reverted
+}
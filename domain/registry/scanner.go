@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/goccy/go-json"
+
+	"github.com/forta-protocol/forta-core-go/contracts/contract_scanner_registry"
+	"github.com/forta-protocol/forta-core-go/utils"
+)
+
+var SaveScanner = "SaveScanner"
+var DisableScanner = "DisableScanner"
+var EnableScanner = "EnableScanner"
+
+type ScannerMessage struct {
+	Message
+	ScannerID string `json:"scannerId"`
+	TxHash    string `json:"txHash"`
+	// Replayed is true when this message was reconstructed from a
+	// registry.Snapshotter snapshot rather than observed live.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+type ScannerSaveMessage struct {
+	ScannerMessage
+	Enabled  bool   `json:"enabled"`
+	ChainID  int64  `json:"chainId"`
+	Metadata string `json:"metadata"`
+	Owner    string `json:"owner"`
+}
+
+func ParseScannerSave(msg string) (*ScannerSaveMessage, error) {
+	var save ScannerSaveMessage
+	err := json.Unmarshal([]byte(msg), &save)
+	if err != nil {
+		return nil, err
+	}
+	if save.Action != SaveScanner {
+		return nil, fmt.Errorf("invalid action for ScannerSave: %s", save.Action)
+	}
+	return &save, nil
+}
+
+func ParseScannerMessage(msg string) (*ScannerMessage, error) {
+	var m ScannerMessage
+	err := json.Unmarshal([]byte(msg), &m)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func NewScannerMessage(evt *contract_scanner_registry.ScannerRegistryScannerEnabled) *ScannerMessage {
+	scannerID := utils.Hex(evt.ScannerId)
+	evtName := DisableScanner
+	if evt.Enabled {
+		evtName = EnableScanner
+	}
+	return &ScannerMessage{
+		Message: Message{
+			Action: evtName,
+		},
+		ScannerID: scannerID,
+		TxHash:    evt.Raw.TxHash.Hex(),
+	}
+}
+
+func NewScannerSaveMessage(evt *contract_scanner_registry.ScannerRegistryScannerUpdated) *ScannerSaveMessage {
+	scannerID := utils.Hex(evt.ScannerId)
+	return &ScannerSaveMessage{
+		ScannerMessage: ScannerMessage{
+			ScannerID: scannerID,
+			Message: Message{
+				Action: SaveScanner,
+			},
+			TxHash: evt.Raw.TxHash.Hex(),
+		},
+		Enabled:  true,
+		ChainID:  evt.ChainId.Int64(),
+		Metadata: evt.Metadata,
+		Owner:    evt.By.Hex(),
+	}
+}
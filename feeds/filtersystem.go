@@ -0,0 +1,443 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	goethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/forta-protocol/forta-core-go/clients/health"
+	"github.com/forta-protocol/forta-core-go/domain"
+)
+
+// DefaultPollInterval is used when Config.PollInterval is unset.
+const DefaultPollInterval = 15 * time.Second
+
+// DefaultMaxReorgDepth is used when Config.MaxReorgDepth is unset. Each poll
+// re-requests this many blocks behind the previous poll's tip, so a log that
+// was only ever seen on an orphaned fork gets superseded by its canonical
+// replacement instead of going unnoticed.
+const DefaultMaxReorgDepth = 12
+
+// DefaultCacheSize is used when Config.CacheSize is unset.
+const DefaultCacheSize = 4096
+
+// Client is the subset of ethereum.Client the FilterSystem needs to poll for
+// logs and new heads.
+type Client interface {
+	BlockNumber(ctx context.Context) (*big.Int, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*domain.Block, error)
+	FilterLogs(ctx context.Context, query goethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Config configures a FilterSystem.
+type Config struct {
+	// PollInterval is how often the FilterSystem re-polls the upstream
+	// client for logs covering the union of all active subscriptions.
+	PollInterval time.Duration
+	// MaxReorgDepth bounds how far behind the previous poll's tip each poll
+	// re-requests logs from, so late-arriving reorgs are still caught.
+	MaxReorgDepth int
+	// CacheSize bounds the LRU of recently delivered log keys used to
+	// deduplicate logs re-observed after a reorg of a shallow fork.
+	CacheSize int
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = DefaultPollInterval
+	}
+	if cfg.MaxReorgDepth <= 0 {
+		cfg.MaxReorgDepth = DefaultMaxReorgDepth
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+	return cfg
+}
+
+// Subscription is returned from FilterSystem.SubscribeLogs/SubscribeNewHeads.
+// It plugs into the existing health.Reporter convention so every
+// subscription is individually observable.
+type Subscription interface {
+	health.Reporter
+	Unsubscribe()
+}
+
+// logSubscription delivers logs matching query to ch. seen deduplicates logs
+// re-observed across overlapping polling windows (MaxReorgDepth makes
+// consecutive polls overlap); it is per-subscription so a subscription that
+// joins after an overlap was already delivered to an earlier subscriber still
+// gets its own, independent first delivery of it.
+type logSubscription struct {
+	fs        *FilterSystem
+	id        uint64
+	query     goethereum.FilterQuery
+	ch        chan<- types.Log
+	seen      *recentKeyCache
+	delivered uint64
+	dropped   uint64
+}
+
+func (s *logSubscription) Name() string { return fmt.Sprintf("logs.%d", s.id) }
+
+func (s *logSubscription) Health() health.Reports {
+	return health.Reports{
+		{Name: "delivered", Status: health.StatusInfo, Details: fmt.Sprintf("%d", s.delivered)},
+		{Name: "dropped", Status: health.StatusInfo, Details: fmt.Sprintf("%d", s.dropped)},
+	}
+}
+
+func (s *logSubscription) Unsubscribe() { s.fs.removeLogSubscription(s.id) }
+
+// headSubscription delivers new canonical heads to ch.
+type headSubscription struct {
+	fs        *FilterSystem
+	id        uint64
+	ch        chan<- *domain.Block
+	delivered uint64
+}
+
+func (s *headSubscription) Name() string { return fmt.Sprintf("heads.%d", s.id) }
+
+func (s *headSubscription) Health() health.Reports {
+	return health.Reports{
+		{Name: "delivered", Status: health.StatusInfo, Details: fmt.Sprintf("%d", s.delivered)},
+	}
+}
+
+func (s *headSubscription) Unsubscribe() { s.fs.removeHeadSubscription(s.id) }
+
+// FilterSystem maintains a single upstream log-polling loop covering the
+// union of every active subscription's query, and fans matching logs out to
+// each individual subscription. This lets several listeners share one
+// process without multiplying RPC load, following the split popularized by
+// go-ethereum's filters.FilterSystem/filters.EventSystem.
+type FilterSystem struct {
+	ctx    context.Context
+	client Client
+	cfg    Config
+
+	mu       sync.Mutex
+	nextID   uint64
+	logSubs  map[uint64]*logSubscription
+	headSubs map[uint64]*headSubscription
+	lastPoll uint64
+	lastHead string
+}
+
+// NewFilterSystem creates a FilterSystem and starts its polling loop. The
+// loop stops when ctx is canceled.
+func NewFilterSystem(ctx context.Context, client Client, cfg Config) *FilterSystem {
+	fs := &FilterSystem{
+		ctx:      ctx,
+		client:   client,
+		cfg:      cfg.withDefaults(),
+		logSubs:  make(map[uint64]*logSubscription),
+		headSubs: make(map[uint64]*headSubscription),
+	}
+	go fs.run()
+	return fs
+}
+
+// SubscribeLogs registers ch to receive logs matching query. Queries are
+// coalesced into the FilterSystem's single upstream poll, so adding
+// subscriptions does not add upstream RPC calls.
+//
+// The live poll only ever re-requests the last MaxReorgDepth blocks behind
+// its own previous tip - it has no notion of any one subscription's own
+// FromBlock/ToBlock. So if query.FromBlock is set, SubscribeLogs first runs a
+// one-off backfill directly against the upstream client for query's own
+// range, delivering anything it finds before returning. This is what lets a
+// subscription ask for history older than the live poll's window (e.g. a
+// fresh listener's configured start block) without it being silently
+// dropped.
+func (fs *FilterSystem) SubscribeLogs(query goethereum.FilterQuery, ch chan<- types.Log) Subscription {
+	fs.mu.Lock()
+	fs.nextID++
+	sub := &logSubscription{fs: fs, id: fs.nextID, query: query, ch: ch, seen: newRecentKeyCache(fs.cfg.CacheSize)}
+	fs.logSubs[sub.id] = sub
+	fs.mu.Unlock()
+
+	if query.FromBlock != nil {
+		if err := fs.backfillLogs(sub); err != nil {
+			log.WithError(err).WithField("subscription", sub.Name()).Warn("filter system: historical backfill failed")
+		}
+	}
+	return sub
+}
+
+// backfillLogs fetches sub's own query directly from the upstream client,
+// bypassing the union poll, and delivers matching logs to it through the
+// same dedup/delivery path dispatchLogs uses for the live poll.
+func (fs *FilterSystem) backfillLogs(sub *logSubscription) error {
+	logs, err := fs.client.FilterLogs(fs.ctx, sub.query)
+	if err != nil {
+		return err
+	}
+	fs.deliverLogsTo([]*logSubscription{sub}, logs)
+	return nil
+}
+
+// SubscribeNewHeads registers ch to receive each new canonical block as the
+// FilterSystem observes it.
+func (fs *FilterSystem) SubscribeNewHeads(ch chan<- *domain.Block) Subscription {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.nextID++
+	sub := &headSubscription{fs: fs, id: fs.nextID, ch: ch}
+	fs.headSubs[sub.id] = sub
+	return sub
+}
+
+// Tip returns the chain head block number as last observed by the upstream
+// client.
+func (fs *FilterSystem) Tip(ctx context.Context) (uint64, error) {
+	tip, err := fs.client.BlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tip.Uint64(), nil
+}
+
+// HistoricalLogs fetches logs for query directly from the upstream client,
+// bypassing the union poll. Use this for one-off backfills; use
+// SubscribeLogs for anything that should stay live.
+func (fs *FilterSystem) HistoricalLogs(ctx context.Context, query goethereum.FilterQuery) ([]types.Log, error) {
+	return fs.client.FilterLogs(ctx, query)
+}
+
+// BlockByNumber resolves the block at number directly from the upstream
+// client, bypassing the union poll. Feed adapters use this to resolve the
+// block a delivered log actually belongs to, since types.Log only carries a
+// block number/hash, not the full domain.Block.
+func (fs *FilterSystem) BlockByNumber(ctx context.Context, number *big.Int) (*domain.Block, error) {
+	return fs.client.BlockByNumber(ctx, number)
+}
+
+func (fs *FilterSystem) removeLogSubscription(id uint64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.logSubs, id)
+}
+
+func (fs *FilterSystem) removeHeadSubscription(id uint64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	delete(fs.headSubs, id)
+}
+
+// unionQuery merges the addresses of every active log subscription into a
+// single query covering all of them, so one FilterLogs call can serve them
+// all. Topics are left unset - they are re-checked per-subscription when
+// fanning out, since a shared topic filter would be unsound to merge.
+func (fs *FilterSystem) unionQuery(fromBlock *big.Int) goethereum.FilterQuery {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	seen := make(map[string]bool)
+	var addresses []common.Address
+	for _, sub := range fs.logSubs {
+		for _, addr := range sub.query.Addresses {
+			key := addr.Hex()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			addresses = append(addresses, addr)
+		}
+	}
+	return goethereum.FilterQuery{FromBlock: fromBlock, Addresses: addresses}
+}
+
+func (fs *FilterSystem) run() {
+	ticker := time.NewTicker(fs.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fs.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fs.poll(); err != nil {
+				log.WithError(err).Warn("filter system: poll failed")
+			}
+		}
+	}
+}
+
+func (fs *FilterSystem) poll() error {
+	tip, err := fs.client.BlockNumber(fs.ctx)
+	if err != nil {
+		return err
+	}
+	fromBlock := new(big.Int).SetUint64(0)
+	if fs.lastPoll > uint64(fs.cfg.MaxReorgDepth) {
+		fromBlock = new(big.Int).SetUint64(fs.lastPoll - uint64(fs.cfg.MaxReorgDepth))
+	}
+
+	fs.mu.Lock()
+	hasLogSubs := len(fs.logSubs) > 0
+	fs.mu.Unlock()
+	if hasLogSubs {
+		query := fs.unionQuery(fromBlock)
+		logs, err := fs.client.FilterLogs(fs.ctx, query)
+		if err != nil {
+			return fmt.Errorf("failed to poll logs: %v", err)
+		}
+		fs.dispatchLogs(logs)
+	}
+
+	fs.dispatchHead(tip.Uint64())
+	fs.lastPoll = tip.Uint64()
+	return nil
+}
+
+func (fs *FilterSystem) dispatchLogs(logs []types.Log) {
+	fs.mu.Lock()
+	subs := make([]*logSubscription, 0, len(fs.logSubs))
+	for _, sub := range fs.logSubs {
+		subs = append(subs, sub)
+	}
+	fs.mu.Unlock()
+
+	fs.deliverLogsTo(subs, logs)
+}
+
+// deliverLogsTo fans logs out to subs, deduplicating per-subscription and
+// re-checking each subscription's own query (matchesQuery). Used both by the
+// live union poll and by a single subscription's own historical backfill.
+func (fs *FilterSystem) deliverLogsTo(subs []*logSubscription, logs []types.Log) {
+	for _, lg := range logs {
+		key := fmt.Sprintf("%s:%d", lg.BlockHash.Hex(), lg.Index)
+		for _, sub := range subs {
+			if sub.seen.containsAndAdd(key) {
+				continue
+			}
+			if !matchesQuery(sub.query, lg) {
+				continue
+			}
+			select {
+			case sub.ch <- lg:
+				sub.delivered++
+			default:
+				sub.dropped++
+				log.WithField("subscription", sub.Name()).Warn("filter system: dropping log, subscriber channel is full")
+			}
+		}
+	}
+}
+
+func (fs *FilterSystem) dispatchHead(number uint64) {
+	blk, err := fs.client.BlockByNumber(fs.ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		log.WithError(err).Warn("filter system: failed to fetch head block")
+		return
+	}
+	if blk.Hash == fs.lastHead {
+		return
+	}
+	fs.lastHead = blk.Hash
+
+	fs.mu.Lock()
+	subs := make([]*headSubscription, 0, len(fs.headSubs))
+	for _, sub := range fs.headSubs {
+		subs = append(subs, sub)
+	}
+	fs.mu.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.ch <- blk:
+			sub.delivered++
+		default:
+			log.WithField("subscription", sub.Name()).Warn("filter system: dropping head, subscriber channel is full")
+		}
+	}
+}
+
+// matchesQuery reports whether lg matches query's block range, addresses and
+// topics. The block range is checked here because the live poll's own query
+// covers the union window, not any one subscription's FromBlock/ToBlock;
+// negative (tag) bounds are not checked.
+func matchesQuery(query goethereum.FilterQuery, lg types.Log) bool {
+	if query.FromBlock != nil && query.FromBlock.Sign() >= 0 && lg.BlockNumber < query.FromBlock.Uint64() {
+		return false
+	}
+	if query.ToBlock != nil && query.ToBlock.Sign() >= 0 && lg.BlockNumber > query.ToBlock.Uint64() {
+		return false
+	}
+	if len(query.Addresses) > 0 {
+		matched := false
+		for _, addr := range query.Addresses {
+			if addr == lg.Address {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for i, topics := range query.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		if i >= len(lg.Topics) {
+			return false
+		}
+		matched := false
+		for _, topic := range topics {
+			if topic == lg.Topics[i] {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// recentKeyCache is a small, fixed-capacity LRU used to deduplicate logs that
+// get re-observed across polling windows (e.g. because MaxReorgDepth made two
+// polling windows overlap).
+type recentKeyCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    []string
+	present  map[string]bool
+}
+
+func newRecentKeyCache(capacity int) *recentKeyCache {
+	return &recentKeyCache{capacity: capacity, present: make(map[string]bool)}
+}
+
+// containsAndAdd reports whether key was already seen, and records it as the
+// most recently used key either way.
+func (c *recentKeyCache) containsAndAdd(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.present[key] {
+		for i, k := range c.order {
+			if k == key {
+				c.order = append(append(c.order[:i:i], c.order[i+1:]...), key)
+				break
+			}
+		}
+		return true
+	}
+	c.present[key] = true
+	c.order = append(c.order, key)
+	if len(c.order) > c.capacity {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		delete(c.present, oldest)
+	}
+	return false
+}
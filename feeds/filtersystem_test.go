@@ -0,0 +1,126 @@
+package feeds
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	goethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+)
+
+// fakeFilterClient is a hand-rolled fake of the small feeds.Client interface,
+// used instead of a gomock fake since the real ethereum.Client mocks aren't
+// available to this package.
+type fakeFilterClient struct {
+	tip       uint64
+	logs      []types.Log
+	lastQuery goethereum.FilterQuery
+}
+
+func (c *fakeFilterClient) BlockNumber(ctx context.Context) (*big.Int, error) {
+	return new(big.Int).SetUint64(c.tip), nil
+}
+
+func (c *fakeFilterClient) BlockByNumber(ctx context.Context, number *big.Int) (*domain.Block, error) {
+	return &domain.Block{
+		Number: "0x" + number.Text(16),
+		Hash:   "0xhead" + number.String(),
+	}, nil
+}
+
+func (c *fakeFilterClient) FilterLogs(ctx context.Context, query goethereum.FilterQuery) ([]types.Log, error) {
+	c.lastQuery = query
+	var matched []types.Log
+	for _, lg := range c.logs {
+		if query.FromBlock != nil && lg.BlockNumber < query.FromBlock.Uint64() {
+			continue
+		}
+		if query.ToBlock != nil && lg.BlockNumber > query.ToBlock.Uint64() {
+			continue
+		}
+		matched = append(matched, lg)
+	}
+	return matched, nil
+}
+
+func logAt(number uint64, index uint) types.Log {
+	return types.Log{
+		Address:     common.HexToAddress("0xaaa"),
+		BlockNumber: number,
+		BlockHash:   common.BigToHash(new(big.Int).SetUint64(number)),
+		Index:       index,
+	}
+}
+
+func TestFilterSystemSubscribeLogsBackfillsOwnFromBlock(t *testing.T) {
+	client := &fakeFilterClient{
+		tip: 100,
+		logs: []types.Log{
+			logAt(10, 0), // far older than MaxReorgDepth behind tip - only reachable via backfill
+			logAt(95, 0), // within the live poll's window too
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := &FilterSystem{ctx: ctx, client: client, cfg: Config{}.withDefaults(), logSubs: make(map[uint64]*logSubscription), headSubs: make(map[uint64]*headSubscription)}
+
+	ch := make(chan types.Log, 10)
+	sub := fs.SubscribeLogs(goethereum.FilterQuery{FromBlock: big.NewInt(10)}, ch)
+	defer sub.Unsubscribe()
+
+	require.Len(t, ch, 2, "backfill must deliver every log in the subscription's own FromBlock..tip range, not just what a live poll would have found")
+}
+
+func TestFilterSystemSubscribeLogsWithoutFromBlockDoesNotBackfill(t *testing.T) {
+	client := &fakeFilterClient{tip: 100, logs: []types.Log{logAt(10, 0)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := &FilterSystem{ctx: ctx, client: client, cfg: Config{}.withDefaults(), logSubs: make(map[uint64]*logSubscription), headSubs: make(map[uint64]*headSubscription)}
+
+	ch := make(chan types.Log, 10)
+	sub := fs.SubscribeLogs(goethereum.FilterQuery{}, ch)
+	defer sub.Unsubscribe()
+
+	assert.Empty(t, ch, "a subscription with no FromBlock has nothing to backfill")
+}
+
+func TestFilterSystemPollOnlyRequestsMaxReorgDepthBehindLastPoll(t *testing.T) {
+	client := &fakeFilterClient{tip: 100}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := NewFilterSystem(ctx, client, Config{MaxReorgDepth: 12})
+	fs.lastPoll = 50
+	sub := fs.SubscribeLogs(goethereum.FilterQuery{}, make(chan types.Log, 1))
+	defer sub.Unsubscribe()
+
+	require.NoError(t, fs.poll())
+	require.NotNil(t, client.lastQuery.FromBlock)
+	assert.Equal(t, uint64(38), client.lastQuery.FromBlock.Uint64(), "poll starts MaxReorgDepth blocks behind the previous poll's tip")
+	assert.Equal(t, uint64(100), fs.lastPoll)
+}
+
+func TestFilterSystemNewFilterSystemStartsPolling(t *testing.T) {
+	client := &fakeFilterClient{tip: 1, logs: []types.Log{logAt(1, 0)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fs := NewFilterSystem(ctx, client, Config{PollInterval: time.Millisecond})
+	assert.NotNil(t, fs)
+
+	ch := make(chan types.Log, 1)
+	sub := fs.SubscribeLogs(goethereum.FilterQuery{}, ch)
+	defer sub.Unsubscribe()
+
+	select {
+	case lg := <-ch:
+		assert.Equal(t, uint64(1), lg.BlockNumber)
+	case <-time.After(time.Second):
+		t.Fatal("the polling loop never delivered a log")
+	}
+}
@@ -0,0 +1,356 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+	"github.com/forta-protocol/forta-core-go/domain/registry"
+)
+
+// Topic identifies a class of registry event a subscriber can subscribe to.
+type Topic string
+
+const (
+	TopicAgentSave     Topic = "AgentSave"
+	TopicAgentAction   Topic = "AgentAction"
+	TopicScannerSave   Topic = "ScannerSave"
+	TopicScannerAction Topic = "ScannerAction"
+	TopicDispatch      Topic = "Dispatch"
+	TopicAfterBlock    Topic = "AfterBlock"
+)
+
+// Handler is a topic subscriber. msg is the concrete message type for the
+// topic it was registered against (e.g. *registry.AgentSaveMessage for
+// TopicAgentSave, *domain.Block for TopicAfterBlock).
+type Handler func(ctx context.Context, logger *log.Entry, msg interface{}) error
+
+// Middleware wraps a Handler to add cross-cutting behavior (retry, tracing,
+// dedup) once, rather than inside every subscriber.
+type Middleware func(next Handler) Handler
+
+// DeliveryMode controls whether a subscriber is invoked on the publishing
+// goroutine or off of a bounded queue.
+type DeliveryMode int
+
+const (
+	// DeliverySync invokes the subscriber inline with Publish, blocking the
+	// listener until it returns. This is the original Handlers behavior.
+	DeliverySync DeliveryMode = iota
+	// DeliveryAsync queues messages for the subscriber to drain on its own
+	// goroutine, per QueueSize/QueuePolicy.
+	DeliveryAsync
+)
+
+// QueuePolicy decides what happens when an async subscriber's queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock blocks Publish until the subscriber catches up.
+	QueueBlock QueuePolicy = iota
+	// QueueDrop drops the message and logs a warning.
+	QueueDrop
+)
+
+// BusConfig configures the delivery semantics of an EventBus.
+type BusConfig struct {
+	DeliveryMode DeliveryMode
+	// QueueSize is the per-subscriber buffer used in DeliveryAsync. Defaults
+	// to 64 when unset.
+	QueueSize   int
+	QueuePolicy QueuePolicy
+}
+
+// Subscription is returned from a Subscribe* call; Cancel stops delivery to
+// that subscriber.
+type Subscription interface {
+	Cancel()
+}
+
+type queuedMessage struct {
+	ctx    context.Context
+	logger *log.Entry
+	msg    interface{}
+}
+
+// subscriber guards its own closed/queue state with mu, independently of the
+// bus-wide lock, so a Cancel racing a concurrent publish can never close the
+// queue out from under an in-flight send (which would otherwise panic).
+type subscriber struct {
+	id      uint64
+	handler Handler
+	queue   chan queuedMessage
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func (s *subscriber) runAsync() {
+	for qm := range s.queue {
+		if err := s.handler(qm.ctx, qm.logger, qm.msg); err != nil {
+			qm.logger.WithError(err).Warn("registry event bus: async subscriber returned error")
+		}
+	}
+}
+
+// invoke calls a sync (non-queued) subscriber's handler, unless it has since
+// been canceled.
+func (s *subscriber) invoke(ctx context.Context, logger *log.Entry, msg interface{}) error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil
+	}
+	return s.handler(ctx, logger, msg)
+}
+
+// deliver enqueues qm for an async subscriber, unless it has since been
+// canceled. Closing and sending both happen under s.mu, so this never races
+// subscriber.close.
+func (s *subscriber) deliver(qm queuedMessage, policy QueuePolicy, logger *log.Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- qm:
+	default:
+		if policy == QueueBlock {
+			s.queue <- qm
+			return
+		}
+		logger.Warn("registry event bus: dropping event, subscriber queue is full")
+	}
+}
+
+// close marks the subscriber canceled and, for async subscribers, closes its
+// queue so runAsync exits. Guarded by s.mu so it can never race a concurrent
+// deliver.
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.queue != nil {
+		close(s.queue)
+	}
+}
+
+type subscription struct {
+	bus   *EventBus
+	topic Topic
+	id    uint64
+}
+
+func (s *subscription) Cancel() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	subs := s.bus.subscribers[s.topic]
+	for i, sub := range subs {
+		if sub.id != s.id {
+			continue
+		}
+		sub.close()
+		s.bus.subscribers[s.topic] = append(subs[:i:i], subs[i+1:]...)
+		return
+	}
+}
+
+// EventBus is a typed pub/sub bus for registry events. Each topic supports
+// multiple concurrent subscribers; every subscriber is always invoked, even
+// if an earlier one returned an error, so one subscriber's failure never
+// stops delivery to the others. Sync subscriber errors are still aggregated
+// and returned from Publish*, so callers (and instrumentation) observe
+// failures the same way they did before subscribers were fanned out.
+type EventBus struct {
+	cfg         BusConfig
+	mu          sync.RWMutex
+	subscribers map[Topic][]*subscriber
+	middleware  []Middleware
+	nextID      uint64
+}
+
+// NewEventBus creates an EventBus with the given delivery configuration.
+func NewEventBus(cfg BusConfig) *EventBus {
+	return &EventBus{
+		cfg:         cfg,
+		subscribers: make(map[Topic][]*subscriber),
+	}
+}
+
+// Use appends a middleware to the chain subscribers are wrapped with.
+// Middlewares run in the order they were added, outermost first. The chain is
+// applied when a subscriber subscribes, so subscribers added before a call to
+// Use are not wrapped with that middleware.
+func (b *EventBus) Use(mw Middleware) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.middleware = append(b.middleware, mw)
+}
+
+func (b *EventBus) wrap(handler Handler) Handler {
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		handler = b.middleware[i](handler)
+	}
+	return handler
+}
+
+func (b *EventBus) subscribe(topic Topic, handler Handler) Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	sub := &subscriber{id: b.nextID, handler: b.wrap(handler)}
+	if b.cfg.DeliveryMode == DeliveryAsync {
+		queueSize := b.cfg.QueueSize
+		if queueSize <= 0 {
+			queueSize = 64
+		}
+		sub.queue = make(chan queuedMessage, queueSize)
+		go sub.runAsync()
+	}
+	b.subscribers[topic] = append(b.subscribers[topic], sub)
+	return &subscription{bus: b, topic: topic, id: sub.id}
+}
+
+// publish delivers msg to every subscriber of topic. Every subscriber is
+// always invoked regardless of an earlier one's failure - one subscriber's
+// error never stops delivery to the others. For sync subscribers, the errors
+// are still aggregated and returned to the caller (as Handlers-based
+// publishing did before the bus existed); async subscriber errors are logged
+// on their own goroutine and can't be propagated synchronously.
+func (b *EventBus) publish(ctx context.Context, topic Topic, logger *log.Entry, msg interface{}) error {
+	b.mu.RLock()
+	subs := make([]*subscriber, len(b.subscribers[topic]))
+	copy(subs, b.subscribers[topic])
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subs {
+		if sub.queue == nil {
+			if err := sub.invoke(ctx, logger, msg); err != nil {
+				logger.WithError(err).Warn("registry event bus: subscriber returned error")
+				errs = append(errs, err)
+			}
+			continue
+		}
+		sub.deliver(queuedMessage{ctx: ctx, logger: logger, msg: msg}, b.cfg.QueuePolicy, logger)
+	}
+	return errors.Join(errs...)
+}
+
+// SubscribeAgentSave subscribes to TopicAgentSave.
+func (b *EventBus) SubscribeAgentSave(handler func(ctx context.Context, logger *log.Entry, msg *registry.AgentSaveMessage) error) Subscription {
+	return b.subscribe(TopicAgentSave, func(ctx context.Context, logger *log.Entry, msg interface{}) error {
+		return handler(ctx, logger, msg.(*registry.AgentSaveMessage))
+	})
+}
+
+// SubscribeAgentAction subscribes to TopicAgentAction.
+func (b *EventBus) SubscribeAgentAction(handler func(ctx context.Context, logger *log.Entry, msg *registry.AgentMessage) error) Subscription {
+	return b.subscribe(TopicAgentAction, func(ctx context.Context, logger *log.Entry, msg interface{}) error {
+		return handler(ctx, logger, msg.(*registry.AgentMessage))
+	})
+}
+
+// SubscribeScannerSave subscribes to TopicScannerSave.
+func (b *EventBus) SubscribeScannerSave(handler func(ctx context.Context, logger *log.Entry, msg *registry.ScannerSaveMessage) error) Subscription {
+	return b.subscribe(TopicScannerSave, func(ctx context.Context, logger *log.Entry, msg interface{}) error {
+		return handler(ctx, logger, msg.(*registry.ScannerSaveMessage))
+	})
+}
+
+// SubscribeScannerAction subscribes to TopicScannerAction.
+func (b *EventBus) SubscribeScannerAction(handler func(ctx context.Context, logger *log.Entry, msg *registry.ScannerMessage) error) Subscription {
+	return b.subscribe(TopicScannerAction, func(ctx context.Context, logger *log.Entry, msg interface{}) error {
+		return handler(ctx, logger, msg.(*registry.ScannerMessage))
+	})
+}
+
+// SubscribeDispatch subscribes to TopicDispatch.
+func (b *EventBus) SubscribeDispatch(handler func(ctx context.Context, logger *log.Entry, msg *registry.DispatchMessage) error) Subscription {
+	return b.subscribe(TopicDispatch, func(ctx context.Context, logger *log.Entry, msg interface{}) error {
+		return handler(ctx, logger, msg.(*registry.DispatchMessage))
+	})
+}
+
+// SubscribeAfterBlock subscribes to TopicAfterBlock.
+func (b *EventBus) SubscribeAfterBlock(handler func(ctx context.Context, blk *domain.Block) error) Subscription {
+	return b.subscribe(TopicAfterBlock, func(ctx context.Context, logger *log.Entry, msg interface{}) error {
+		return handler(ctx, msg.(*domain.Block))
+	})
+}
+
+// PublishAgentSave publishes msg to TopicAgentSave subscribers.
+func (b *EventBus) PublishAgentSave(ctx context.Context, logger *log.Entry, msg *registry.AgentSaveMessage) error {
+	return b.publish(ctx, TopicAgentSave, logger, msg)
+}
+
+// PublishAgentAction publishes msg to TopicAgentAction subscribers.
+func (b *EventBus) PublishAgentAction(ctx context.Context, logger *log.Entry, msg *registry.AgentMessage) error {
+	return b.publish(ctx, TopicAgentAction, logger, msg)
+}
+
+// PublishScannerSave publishes msg to TopicScannerSave subscribers.
+func (b *EventBus) PublishScannerSave(ctx context.Context, logger *log.Entry, msg *registry.ScannerSaveMessage) error {
+	return b.publish(ctx, TopicScannerSave, logger, msg)
+}
+
+// PublishScannerAction publishes msg to TopicScannerAction subscribers.
+func (b *EventBus) PublishScannerAction(ctx context.Context, logger *log.Entry, msg *registry.ScannerMessage) error {
+	return b.publish(ctx, TopicScannerAction, logger, msg)
+}
+
+// PublishDispatch publishes msg to TopicDispatch subscribers.
+func (b *EventBus) PublishDispatch(ctx context.Context, logger *log.Entry, msg *registry.DispatchMessage) error {
+	return b.publish(ctx, TopicDispatch, logger, msg)
+}
+
+// PublishAfterBlock publishes blk to TopicAfterBlock subscribers.
+func (b *EventBus) PublishAfterBlock(ctx context.Context, blk *domain.Block) error {
+	return b.publish(ctx, TopicAfterBlock, log.WithField("block", blk.Number), blk)
+}
+
+// FromHandlers subscribes the legacy Handlers function fields to b, so
+// embedders that have not migrated to the event bus keep working unchanged.
+// Returns b for chaining, e.g. registry.NewEventBus(cfg).FromHandlers(h).
+func (b *EventBus) FromHandlers(h Handlers) *EventBus {
+	if h.SaveAgentHandler != nil {
+		b.SubscribeAgentSave(func(ctx context.Context, logger *log.Entry, msg *registry.AgentSaveMessage) error {
+			return h.SaveAgentHandler(logger, msg)
+		})
+	}
+	if h.AgentActionHandler != nil {
+		b.SubscribeAgentAction(func(ctx context.Context, logger *log.Entry, msg *registry.AgentMessage) error {
+			return h.AgentActionHandler(logger, msg)
+		})
+	}
+	if h.SaveScannerHandler != nil {
+		b.SubscribeScannerSave(func(ctx context.Context, logger *log.Entry, msg *registry.ScannerSaveMessage) error {
+			return h.SaveScannerHandler(logger, msg)
+		})
+	}
+	if h.ScannerActionHandler != nil {
+		b.SubscribeScannerAction(func(ctx context.Context, logger *log.Entry, msg *registry.ScannerMessage) error {
+			return h.ScannerActionHandler(logger, msg)
+		})
+	}
+	if h.DispatchHandler != nil {
+		b.SubscribeDispatch(func(ctx context.Context, logger *log.Entry, msg *registry.DispatchMessage) error {
+			return h.DispatchHandler(logger, msg)
+		})
+	}
+	if h.AfterBlockHandler != nil {
+		b.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+			return h.AfterBlockHandler(blk)
+		})
+	}
+	return b
+}
@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+	"github.com/forta-protocol/forta-core-go/domain/registry"
+)
+
+func TestEventBusSyncDeliversToAllSubscribersDespiteErrors(t *testing.T) {
+	bus := NewEventBus(BusConfig{})
+
+	var calledA, calledB bool
+	bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		calledA = true
+		return errors.New("subscriber a failed")
+	})
+	bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		calledB = true
+		return nil
+	})
+
+	err := bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x1", Hash: "0xa"})
+
+	assert.True(t, calledA)
+	assert.True(t, calledB, "a failing subscriber must not stop delivery to the others")
+	assert.Error(t, err, "a sync subscriber error must be surfaced to the publisher")
+}
+
+func TestEventBusSyncReturnsNilWhenNoSubscriberErrors(t *testing.T) {
+	bus := NewEventBus(BusConfig{})
+	bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		return nil
+	})
+
+	err := bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x1", Hash: "0xa"})
+	assert.NoError(t, err)
+}
+
+func TestEventBusAsyncDeliversOffPublishingGoroutine(t *testing.T) {
+	bus := NewEventBus(BusConfig{DeliveryMode: DeliveryAsync, QueueSize: 4})
+
+	received := make(chan *domain.Block, 1)
+	bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		received <- blk
+		return nil
+	})
+
+	err := bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x1", Hash: "0xa"})
+	require.NoError(t, err, "async publish never blocks on subscriber errors")
+
+	select {
+	case blk := <-received:
+		assert.Equal(t, "0xa", blk.Hash)
+	case <-time.After(time.Second):
+		t.Fatal("async subscriber was never invoked")
+	}
+}
+
+func TestEventBusAsyncDropsWhenQueueFullAndPolicyIsDrop(t *testing.T) {
+	bus := NewEventBus(BusConfig{DeliveryMode: DeliveryAsync, QueueSize: 1, QueuePolicy: QueueDrop})
+
+	block := make(chan struct{})
+	bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		<-block // never returns until the test unblocks it
+		return nil
+	})
+
+	// First publish is picked up immediately by the subscriber goroutine,
+	// second fills the size-1 queue, third must be dropped rather than block.
+	for i := 0; i < 3; i++ {
+		err := bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x1", Hash: "0xa"})
+		assert.NoError(t, err)
+	}
+	close(block)
+}
+
+func TestEventBusCancelStopsFurtherDelivery(t *testing.T) {
+	bus := NewEventBus(BusConfig{})
+
+	var calls int
+	sub := bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		calls++
+		return nil
+	})
+
+	require.NoError(t, bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x1", Hash: "0xa"}))
+	sub.Cancel()
+	require.NoError(t, bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x2", Hash: "0xb"}))
+
+	assert.Equal(t, 1, calls, "a canceled subscriber must not be invoked again")
+}
+
+// TestEventBusCancelDuringPublishDoesNotPanic exercises the race the review
+// flagged: Cancel closing an async subscriber's queue while a publish is
+// concurrently trying to send to it. Before the fix, this could send on a
+// closed channel and panic; subscriber.mu now makes close and deliver
+// mutually exclusive.
+func TestEventBusCancelDuringPublishDoesNotPanic(t *testing.T) {
+	bus := NewEventBus(BusConfig{DeliveryMode: DeliveryAsync, QueueSize: 1})
+	sub := bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = bus.PublishAfterBlock(context.Background(), &domain.Block{Number: "0x1", Hash: "0xa"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		sub.Cancel()
+	}()
+	wg.Wait()
+}
+
+func TestEventBusSubscribeAgentSaveTypeAsserts(t *testing.T) {
+	bus := NewEventBus(BusConfig{})
+
+	var gotLogger *log.Entry
+	var gotMsg *registry.AgentSaveMessage
+	bus.SubscribeAgentSave(func(ctx context.Context, logger *log.Entry, msg *registry.AgentSaveMessage) error {
+		gotLogger = logger
+		gotMsg = msg
+		return nil
+	})
+
+	want := &registry.AgentSaveMessage{AgentMessage: registry.AgentMessage{AgentID: "0x1"}}
+	require.NoError(t, bus.PublishAgentSave(context.Background(), log.WithField("test", true), want))
+	assert.NotNil(t, gotLogger)
+	assert.Same(t, want, gotMsg)
+}
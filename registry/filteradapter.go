@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"context"
+	"math/big"
+
+	goethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+	"github.com/forta-protocol/forta-core-go/feeds"
+)
+
+// logFeed is the subset of feeds.LogFeed the listener depends on. Declaring
+// it locally, rather than depending on the feeds.LogFeed interface directly,
+// lets any feed implementation - including one backed by a shared
+// feeds.FilterSystem - satisfy it.
+type logFeed interface {
+	ForEachLog(handleLog func(blk *domain.Block, le types.Log) error, handleAfterBlock func(blk *domain.Block) error) error
+	GetLogsForLastBlocks(blocksAgo int64) ([]types.Log, error)
+	// GetLogsForBlockRange fetches logs starting fromBlocksAgo blocks behind
+	// the current tip, up to toBlocksAgo blocks behind it. Callers that need
+	// every returned log to already sit behind the chain's finality boundary
+	// (e.g. ProcessLastFinalizedBlocks) set toBlocksAgo to that depth instead
+	// of leaving the upper end at the tip.
+	GetLogsForBlockRange(fromBlocksAgo, toBlocksAgo int64) ([]types.Log, error)
+}
+
+// filterSystemLogFeed adapts a shared feeds.FilterSystem into the logFeed
+// shape the listener expects. Configuring ListenerConfig.FilterSystem lets
+// several listeners (e.g. the registry listener plus a user's own contract
+// listener) run off one FilterSystem instead of each opening its own
+// eth_getLogs/eth_subscribe polling loop.
+type filterSystemLogFeed struct {
+	ctx       context.Context
+	fs        *feeds.FilterSystem
+	addresses []common.Address
+	// fromBlock is the listener's configured start block, passed through to
+	// the FilterSystem subscription so its one-off backfill (see
+	// FilterSystem.SubscribeLogs) picks up history older than the live
+	// poll's own MaxReorgDepth window. Nil means no backfill: only logs the
+	// live poll returns are delivered (a FilterSystem's first poll starts at
+	// block 0).
+	fromBlock *big.Int
+}
+
+func newFilterSystemLogFeed(ctx context.Context, fs *feeds.FilterSystem, addresses []common.Address, fromBlock *big.Int) *filterSystemLogFeed {
+	return &filterSystemLogFeed{ctx: ctx, fs: fs, addresses: addresses, fromBlock: fromBlock}
+}
+
+func (f *filterSystemLogFeed) query(fromBlock *big.Int) goethereum.FilterQuery {
+	return goethereum.FilterQuery{FromBlock: fromBlock, Addresses: f.addresses}
+}
+
+// ForEachLog subscribes to live logs and heads through the FilterSystem and
+// invokes handleLog/handleAfterBlock as they arrive, until ctx is canceled.
+//
+// Each log is resolved against the block it actually belongs to (by
+// lg.BlockNumber), not whichever head last arrived on the independent heads
+// channel - a poll can return logs spanning many blocks, and select gives no
+// ordering guarantee between logCh and headCh, so a shared "current head"
+// variable would mis-bucket most of them.
+func (f *filterSystemLogFeed) ForEachLog(handleLog func(blk *domain.Block, le types.Log) error, handleAfterBlock func(blk *domain.Block) error) error {
+	logCh := make(chan types.Log, 256)
+	headCh := make(chan *domain.Block, 16)
+	logSub := f.fs.SubscribeLogs(f.query(f.fromBlock), logCh)
+	headSub := f.fs.SubscribeNewHeads(headCh)
+	defer logSub.Unsubscribe()
+	defer headSub.Unsubscribe()
+
+	blocks := newBlockNumberCache(f.fs, blockNumberCacheSize)
+	for {
+		select {
+		case <-f.ctx.Done():
+			return f.ctx.Err()
+		case lg := <-logCh:
+			blk, err := blocks.get(f.ctx, lg.BlockNumber, lg.BlockHash.Hex())
+			if err != nil {
+				return err
+			}
+			if err := handleLog(blk, lg); err != nil {
+				return err
+			}
+		case blk := <-headCh:
+			if err := handleAfterBlock(blk); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GetLogsForLastBlocks fetches historical logs directly from the
+// FilterSystem, bypassing its live subscriptions, up to the current tip.
+func (f *filterSystemLogFeed) GetLogsForLastBlocks(blocksAgo int64) ([]types.Log, error) {
+	return f.GetLogsForBlockRange(blocksAgo, 0)
+}
+
+// GetLogsForBlockRange fetches historical logs directly from the
+// FilterSystem for the range [tip-fromBlocksAgo, tip-toBlocksAgo], bypassing
+// its live subscriptions.
+func (f *filterSystemLogFeed) GetLogsForBlockRange(fromBlocksAgo, toBlocksAgo int64) ([]types.Log, error) {
+	tip, err := f.fs.Tip(f.ctx)
+	if err != nil {
+		return nil, err
+	}
+	from := int64(tip) - fromBlocksAgo
+	if from < 0 {
+		from = 0
+	}
+	to := int64(tip) - toBlocksAgo
+	if to < from {
+		to = from
+	}
+	query := f.query(big.NewInt(from))
+	query.ToBlock = big.NewInt(to)
+	return f.fs.HistoricalLogs(f.ctx, query)
+}
+
+// blockNumberCacheSize bounds blockNumberCache so a long-running feed doesn't
+// grow the cache without limit; logs for the same block typically arrive
+// together, so even a small cache avoids most repeat fetches.
+const blockNumberCacheSize = 256
+
+// blockNumberCache resolves a log's block by number, memoizing fetches
+// through fs.BlockByNumber. A cached entry is discarded and refetched if the
+// requested hash no longer matches, so a reorg of a still-cached block is
+// picked up rather than silently served stale.
+type blockNumberCache struct {
+	fs       *feeds.FilterSystem
+	capacity int
+	order    []uint64
+	blocks   map[uint64]*domain.Block
+}
+
+func newBlockNumberCache(fs *feeds.FilterSystem, capacity int) *blockNumberCache {
+	return &blockNumberCache{fs: fs, capacity: capacity, blocks: make(map[uint64]*domain.Block)}
+}
+
+func (c *blockNumberCache) get(ctx context.Context, number uint64, hash string) (*domain.Block, error) {
+	if blk, ok := c.blocks[number]; ok && blk.Hash == hash {
+		return blk, nil
+	}
+	blk, err := c.fs.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.blocks[number]; !ok {
+		c.order = append(c.order, number)
+		if len(c.order) > c.capacity {
+			delete(c.blocks, c.order[0])
+			c.order = c.order[1:]
+		}
+	}
+	c.blocks[number] = blk
+	return blk, nil
+}
@@ -0,0 +1,284 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+)
+
+// DefaultFinalityDepth is the number of confirmations a buffered block must
+// accumulate before its registry events are promoted to handlers, used when
+// ListenerConfig.FinalityDepth is not set (and FinalityProvider is not set).
+const DefaultFinalityDepth = 12
+
+// BlockImportHandler is notified once a block's registry events have all been
+// promoted to the handlers in Handlers. finalized is true once the block has
+// passed FinalityDepth confirmations, or FinalityProvider reports it final -
+// whichever is configured.
+type BlockImportHandler interface {
+	HandleBlockImport(ctx context.Context, blk *domain.Block, finalized bool) error
+}
+
+// FinalityProvider answers whether a block hash can no longer be reorged away,
+// e.g. by consulting a beacon chain checkpoint or an L2's finalized tag. When
+// configured, it takes precedence over ListenerConfig.FinalityDepth.
+type FinalityProvider interface {
+	IsFinalized(blockHash string) (bool, error)
+}
+
+// logReplayer is implemented by feeds.LogFeed. It lets the listener re-fetch a
+// single block's logs after a reorg is detected, without re-scanning from
+// genesis. Feeds that don't support it are simply skipped on reorg.
+type logReplayer interface {
+	GetLogsForBlock(number uint64) ([]types.Log, error)
+}
+
+// bufferedEvent is a deferred handler invocation, along with the compensating
+// call to make if its block is reorged away after already being promoted.
+type bufferedEvent struct {
+	deliver func() error
+	revert  func() error
+}
+
+// bufferedBlock holds the events produced while processing a single block,
+// pending promotion to handlers once the block is final.
+type bufferedBlock struct {
+	number   uint64
+	hash     string
+	blk      *domain.Block
+	events   []bufferedEvent
+	promoted bool
+
+	// promotedAt is the tip at which the block was promoted.
+	promotedAt uint64
+}
+
+// blockRing buffers recent blocks by number so the listener can detect reorgs
+// and replay compensating events before promoting the canonical chain to
+// handlers. Once a block is promoted, it moves into a separate, shorter-lived
+// retired set rather than being dropped outright - a reorg deep enough to
+// reach an already-promoted block is rare but not impossible, and the
+// retired set is what lets the listener still notice it and emit compensating
+// Revert* messages instead of silently leaving delivered state incorrect.
+type blockRing struct {
+	mu           sync.Mutex
+	items        map[uint64]*bufferedBlock
+	order        []uint64
+	retired      map[uint64]*bufferedBlock
+	retiredOrder []uint64
+}
+
+func newBlockRing() *blockRing {
+	return &blockRing{
+		items:   make(map[uint64]*bufferedBlock),
+		retired: make(map[uint64]*bufferedBlock),
+	}
+}
+
+func (r *blockRing) getOrCreate(number uint64, blk *domain.Block) *bufferedBlock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fb, ok := r.items[number]
+	if !ok {
+		fb = &bufferedBlock{number: number, hash: blk.Hash, blk: blk}
+		r.items[number] = fb
+		r.order = append(r.order, number)
+	}
+	return fb
+}
+
+func (r *blockRing) remove(number uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.items, number)
+	for i, n := range r.order {
+		if n == number {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// oldest returns the currently buffered, not-yet-promoted blocks in the order
+// they were first buffered; it does not sort them by block number.
+func (r *blockRing) oldest() []*bufferedBlock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*bufferedBlock, len(r.order))
+	for i, n := range r.order {
+		out[i] = r.items[n]
+	}
+	return out
+}
+
+// retire moves a just-promoted block from the active set into the retired
+// set, where it is still watched for reorgs for a while longer.
+func (r *blockRing) retire(number uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fb, ok := r.items[number]
+	if !ok {
+		return
+	}
+	delete(r.items, number)
+	for i, n := range r.order {
+		if n == number {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	r.retired[number] = fb
+	r.retiredOrder = append(r.retiredOrder, number)
+}
+
+// removeRetired drops a block from the retired set, once it has either been
+// confirmed safely final or been handled as a post-promotion reorg.
+func (r *blockRing) removeRetired(number uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.retired, number)
+	for i, n := range r.retiredOrder {
+		if n == number {
+			r.retiredOrder = append(r.retiredOrder[:i], r.retiredOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+// retiredBlocks returns the currently retired (already-promoted) blocks in
+// the order they were retired; it does not sort them by block number.
+func (r *blockRing) retiredBlocks() []*bufferedBlock {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]*bufferedBlock, len(r.retiredOrder))
+	for i, n := range r.retiredOrder {
+		out[i] = r.retired[n]
+	}
+	return out
+}
+
+// isFinalized reports whether a buffered block has accumulated enough
+// confirmations, or been confirmed final by the configured FinalityProvider.
+func (l *listener) isFinalized(fb *bufferedBlock, tip uint64) (bool, error) {
+	if l.cfg.FinalityProvider != nil {
+		return l.cfg.FinalityProvider.IsFinalized(fb.hash)
+	}
+	return tip >= fb.number+uint64(l.finalityDepth), nil
+}
+
+// promoteFinalizedBlocks walks the buffered blocks oldest-first, checks each
+// for a reorg by re-resolving its canonical hash, and promotes to handlers any
+// block that both remains canonical and has reached finality. Blocks that
+// were already promoted stay watched for a further finalityDepth confirmations
+// in the ring's retired set, so a deep reorg reaching back past finality is
+// still caught and compensated with Revert* messages, rather than becoming
+// silently unrecoverable the moment a block is promoted.
+func (l *listener) promoteFinalizedBlocks(tip uint64) error {
+	for _, fb := range l.ring.retiredBlocks() {
+		canonicalHash, err := l.canonicalHashAt(fb.number)
+		if err != nil {
+			return fmt.Errorf("failed to resolve canonical hash for promoted block %d: %v", fb.number, err)
+		}
+		if canonicalHash != fb.hash {
+			if err := l.handleReorg(fb, canonicalHash); err != nil {
+				return err
+			}
+			continue
+		}
+		if tip >= fb.promotedAt+uint64(l.finalityDepth) {
+			l.ring.removeRetired(fb.number)
+		}
+	}
+
+	for _, fb := range l.ring.oldest() {
+		canonicalHash, err := l.canonicalHashAt(fb.number)
+		if err != nil {
+			return fmt.Errorf("failed to resolve canonical hash for block %d: %v", fb.number, err)
+		}
+		if canonicalHash != fb.hash {
+			if err := l.handleReorg(fb, canonicalHash); err != nil {
+				return err
+			}
+			continue
+		}
+
+		final, err := l.isFinalized(fb, tip)
+		if err != nil {
+			return err
+		}
+		if !final {
+			continue
+		}
+
+		for _, evt := range fb.events {
+			if err := evt.deliver(); err != nil {
+				return err
+			}
+		}
+		fb.promoted = true
+		fb.promotedAt = tip
+		if l.cfg.BlockImportHandler != nil {
+			if err := l.cfg.BlockImportHandler.HandleBlockImport(l.ctx, fb.blk, true); err != nil {
+				return err
+			}
+		}
+		l.ring.retire(fb.number)
+	}
+	return nil
+}
+
+// handleReorg drops a buffered block whose canonical hash no longer matches
+// what was originally observed. If the block's events were already promoted to
+// handlers, compensating Revert* messages are emitted first so consumer state
+// can be rolled back before the new canonical logs are replayed. Replayed logs
+// are attached to a freshly-resolved canonical block, not the stale, reorged-
+// away fb.blk - otherwise the re-buffered entry would inherit the old hash and
+// every later promoteFinalizedBlocks call would detect the same "reorg" again.
+func (l *listener) handleReorg(fb *bufferedBlock, newHash string) error {
+	logger := log.WithFields(log.Fields{
+		"block":   fb.number,
+		"oldHash": fb.hash,
+		"newHash": newHash,
+	})
+	logger.Warn("detected reorg while buffering block for finality")
+
+	if fb.promoted {
+		for _, evt := range fb.events {
+			if evt.revert == nil {
+				continue
+			}
+			if err := evt.revert(); err != nil {
+				return err
+			}
+		}
+		l.ring.removeRetired(fb.number)
+	} else {
+		l.ring.remove(fb.number)
+	}
+
+	replayer, ok := l.logs.(logReplayer)
+	if !ok {
+		logger.Warn("log feed does not support replay - new canonical logs for this block will be missed")
+		return nil
+	}
+	canonicalBlk, err := l.client.BlockByNumber(l.ctx, new(big.Int).SetUint64(fb.number))
+	if err != nil {
+		return err
+	}
+	logs, err := replayer.GetLogsForBlock(fb.number)
+	if err != nil {
+		return err
+	}
+	for _, lg := range logs {
+		if err := l.handleLog(canonicalBlk, lg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+)
+
+func TestBlockRingGetOrCreateIsIdempotent(t *testing.T) {
+	ring := newBlockRing()
+	blk := &domain.Block{Number: "0x1", Hash: "0xaaa"}
+
+	fb := ring.getOrCreate(1, blk)
+	assert.Equal(t, "0xaaa", fb.hash)
+
+	// A second getOrCreate for the same number returns the existing entry -
+	// it must not overwrite the hash with whatever blk is passed this time.
+	again := ring.getOrCreate(1, &domain.Block{Number: "0x1", Hash: "0xbbb"})
+	assert.Same(t, fb, again)
+	assert.Equal(t, "0xaaa", again.hash)
+}
+
+func TestBlockRingOldestOrdering(t *testing.T) {
+	ring := newBlockRing()
+	ring.getOrCreate(3, &domain.Block{Number: "0x3", Hash: "0xc"})
+	ring.getOrCreate(1, &domain.Block{Number: "0x1", Hash: "0xa"})
+	ring.getOrCreate(2, &domain.Block{Number: "0x2", Hash: "0xb"})
+
+	var numbers []uint64
+	for _, fb := range ring.oldest() {
+		numbers = append(numbers, fb.number)
+	}
+	assert.Equal(t, []uint64{3, 1, 2}, numbers, "oldest() preserves insertion order, it does not sort")
+}
+
+func TestBlockRingRetireMovesOutOfActiveSet(t *testing.T) {
+	ring := newBlockRing()
+	ring.getOrCreate(1, &domain.Block{Number: "0x1", Hash: "0xa"})
+
+	ring.retire(1)
+
+	assert.Empty(t, ring.oldest(), "a retired block must no longer be scanned as an active, not-yet-promoted block")
+	retired := ring.retiredBlocks()
+	assert.Len(t, retired, 1)
+	assert.Equal(t, uint64(1), retired[0].number)
+}
+
+func TestBlockRingRemoveRetired(t *testing.T) {
+	ring := newBlockRing()
+	ring.getOrCreate(5, &domain.Block{Number: "0x5", Hash: "0xa"})
+	ring.retire(5)
+
+	ring.removeRetired(5)
+
+	assert.Empty(t, ring.retiredBlocks())
+}
+
+func TestBlockRingRetireOfUnknownNumberIsNoop(t *testing.T) {
+	ring := newBlockRing()
+	ring.retire(42)
+	assert.Empty(t, ring.retiredBlocks())
+}
+
+func TestListenerIsFinalizedByDepth(t *testing.T) {
+	l := &listener{finalityDepth: 12}
+	fb := &bufferedBlock{number: 100, hash: "0xabc"}
+
+	final, err := l.isFinalized(fb, 111)
+	assert.NoError(t, err)
+	assert.False(t, final, "tip is one confirmation short of finalityDepth")
+
+	final, err = l.isFinalized(fb, 112)
+	assert.NoError(t, err)
+	assert.True(t, final)
+}
+
+type fakeFinalityProvider struct {
+	finalHashes map[string]bool
+}
+
+func (p *fakeFinalityProvider) IsFinalized(blockHash string) (bool, error) {
+	return p.finalHashes[blockHash], nil
+}
+
+func TestListenerIsFinalizedPrefersFinalityProvider(t *testing.T) {
+	l := &listener{
+		finalityDepth: 12,
+		cfg: ListenerConfig{
+			FinalityProvider: &fakeFinalityProvider{finalHashes: map[string]bool{"0xabc": true}},
+		},
+	}
+	fb := &bufferedBlock{number: 100, hash: "0xabc"}
+
+	// Tip is nowhere near finalityDepth confirmations, but the
+	// FinalityProvider takes precedence and says it's final.
+	final, err := l.isFinalized(fb, 101)
+	assert.NoError(t, err)
+	assert.True(t, final)
+}
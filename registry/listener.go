@@ -6,8 +6,10 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/forta-protocol/forta-core-go/clients/health"
 	"github.com/forta-protocol/forta-core-go/contracts/contract_agent_registry"
 	"github.com/forta-protocol/forta-core-go/contracts/contract_dispatch"
 	"github.com/forta-protocol/forta-core-go/contracts/contract_scanner_registry"
@@ -16,12 +18,14 @@ import (
 	"github.com/forta-protocol/forta-core-go/ens"
 	"github.com/forta-protocol/forta-core-go/ethereum"
 	"github.com/forta-protocol/forta-core-go/feeds"
+	"github.com/forta-protocol/forta-core-go/utils"
 )
 
 type listener struct {
-	ctx  context.Context
-	cfg  ListenerConfig
-	logs feeds.LogFeed
+	ctx    context.Context
+	cfg    ListenerConfig
+	logs   logFeed
+	client ethereum.Client
 
 	scannerAddr  string
 	agentAddr    string
@@ -30,6 +34,11 @@ type listener struct {
 	scannerFilterer  *contract_scanner_registry.ScannerRegistryFilterer
 	agentsFilterer   *contract_agent_registry.AgentRegistryFilterer
 	dispatchFilterer *contract_dispatch.DispatchFilterer
+
+	ring          *blockRing
+	finalityDepth int
+
+	bus *EventBus
 }
 
 type Handlers struct {
@@ -48,12 +57,42 @@ type ListenerConfig struct {
 	ENSAddress  string
 	StartBlock  *big.Int
 	BlockOffset int
-	Handlers    Handlers
+	// Handlers is the legacy single-subscriber configuration. It is
+	// subscribed onto EventBus via EventBus.FromHandlers when EventBus is
+	// not set, so existing embedders keep working unchanged.
+	Handlers Handlers
+	// EventBus, if set, is used instead of Handlers and allows multiple
+	// concurrent subscribers per topic. Prefer this for new integrations.
+	EventBus *EventBus
+
+	// FilterSystem, if set, is used instead of a dedicated feeds.LogFeed so
+	// this listener shares its upstream polling with other subscribers of
+	// the same FilterSystem.
+	FilterSystem *feeds.FilterSystem
+
+	// BlockImportHandler, if set, is notified once per block after that
+	// block's registry events have been promoted to Handlers.
+	BlockImportHandler BlockImportHandler
+	// FinalityProvider, if set, decides when a buffered block is final.
+	// Takes precedence over FinalityDepth.
+	FinalityProvider FinalityProvider
+	// FinalityDepth is the number of confirmations required before a
+	// buffered block's events are promoted to Handlers, when
+	// FinalityProvider is not set. Defaults to DefaultFinalityDepth.
+	FinalityDepth int
+
+	// MetricsRegistry is where this listener's Prometheus collectors are
+	// registered. Defaults to health.Registry. Set this to the same
+	// *prometheus.Registry passed to health.WithRegistry so the listener's
+	// metrics actually show up on that service's /metrics instead of a
+	// registry nothing serves.
+	MetricsRegistry *prometheus.Registry
 }
 
 type Listener interface {
 	Listen() error
 	ProcessLastBlocks(blocksAgo int64) error
+	ProcessLastFinalizedBlocks(blocksAgo int64) error
 }
 
 func (l *listener) isDispatcher(address common.Address) bool {
@@ -68,89 +107,173 @@ func (l *listener) isAgentRegistry(address common.Address) bool {
 	return equalsAddress(address, l.agentAddr)
 }
 
-func (l *listener) handleScannerRegistryEvent(le types.Log, logger *log.Entry) error {
+// handleScannerRegistryEvent parses a scanner registry log and returns the
+// deliver/revert closures for it, or a nil deliver if the log is not a
+// scanner event the listener publishes.
+func (l *listener) handleScannerRegistryEvent(le types.Log, logger *log.Entry) (deliver func() error, revert func() error, err error) {
 	if isEvent(le, contract_scanner_registry.ScannerUpdatedTopic) {
 		su, err := l.scannerFilterer.ParseScannerUpdated(le)
 		if err != nil {
-			return err
-		}
-		if l.cfg.Handlers.SaveScannerHandler != nil {
-			return l.cfg.Handlers.SaveScannerHandler(logger, registry.NewScannerSaveMessage(su))
+			return nil, nil, err
 		}
+		msg := registry.NewScannerSaveMessage(su)
+		return func() error {
+				return l.bus.PublishScannerSave(l.ctx, logger, msg)
+			}, func() error {
+				return l.bus.PublishScannerSave(l.ctx, logger, registry.NewRevertScannerSaveMessage(msg))
+			}, nil
 	} else if isEvent(le, contract_scanner_registry.ScannerEnabledTopic) {
 		se, err := l.scannerFilterer.ParseScannerEnabled(le)
 		if err != nil {
-			return err
-		}
-		if l.cfg.Handlers.ScannerActionHandler != nil {
-			return l.cfg.Handlers.ScannerActionHandler(logger, registry.NewScannerMessage(se))
+			return nil, nil, err
 		}
+		msg := registry.NewScannerMessage(se)
+		return func() error {
+			return l.bus.PublishScannerAction(l.ctx, logger, msg)
+		}, nil, nil
 	}
-	return nil
+	return nil, nil, nil
 }
 
-func (l *listener) handleAgentRegistryEvent(le types.Log, logger *log.Entry) error {
+// handleAgentRegistryEvent parses an agent registry log and returns the
+// deliver/revert closures for it, or a nil deliver if the log is not an
+// agent event the listener publishes.
+func (l *listener) handleAgentRegistryEvent(le types.Log, logger *log.Entry) (deliver func() error, revert func() error, err error) {
 	if isEvent(le, contract_agent_registry.AgentUpdatedTopic) {
 		au, err := l.agentsFilterer.ParseAgentUpdated(le)
 		if err != nil {
-			return err
-		}
-		if l.cfg.Handlers.SaveAgentHandler != nil {
-			return l.cfg.Handlers.SaveAgentHandler(logger, registry.NewAgentSaveMessage(au))
+			return nil, nil, err
 		}
+		msg := registry.NewAgentSaveMessage(au)
+		return func() error {
+				return l.bus.PublishAgentSave(l.ctx, logger, msg)
+			}, func() error {
+				return l.bus.PublishAgentSave(l.ctx, logger, registry.NewRevertAgentSaveMessage(msg))
+			}, nil
 	} else if isEvent(le, contract_agent_registry.AgentEnabledTopic) {
 		ae, err := l.agentsFilterer.ParseAgentEnabled(le)
 		if err != nil {
-			return err
-		}
-		if l.cfg.Handlers.AgentActionHandler != nil {
-			return l.cfg.Handlers.AgentActionHandler(logger, registry.NewAgentMessage(ae))
+			return nil, nil, err
 		}
+		msg := registry.NewAgentMessage(ae)
+		return func() error {
+			return l.bus.PublishAgentAction(l.ctx, logger, msg)
+		}, nil, nil
 	}
-	return nil
+	return nil, nil, nil
 }
 
-func (l *listener) handleDispatcherEvent(le types.Log, logger *log.Entry) error {
+// handleDispatcherEvent parses a dispatch log and returns the deliver/revert
+// closures for it, or a nil deliver if the log is not a dispatch event the
+// listener publishes.
+func (l *listener) handleDispatcherEvent(le types.Log, logger *log.Entry) (deliver func() error, revert func() error, err error) {
 	if isEvent(le, contract_dispatch.LinkTopic) {
 		link, err := l.dispatchFilterer.ParseLink(le)
 		if err != nil {
-			return err
-		}
-		if l.cfg.Handlers.DispatchHandler != nil {
-			return l.cfg.Handlers.DispatchHandler(logger, registry.NewDispatchMessage(link))
+			return nil, nil, err
 		}
+		msg := registry.NewDispatchMessage(link)
+		return func() error {
+				return l.bus.PublishDispatch(l.ctx, logger, msg)
+			}, func() error {
+				return l.bus.PublishDispatch(l.ctx, logger, registry.NewRevertDispatchMessage(msg))
+			}, nil
 	}
-	return nil
+	return nil, nil, nil
+}
+
+// eventForLog routes a log to the contract-specific parser and returns the
+// deliver/revert closures for the resulting message, if the log is an event
+// the listener publishes. The deliver closure is instrumented with the
+// forta_registry_logs_total/handler_errors/handler_duration metrics.
+func (l *listener) eventForLog(le types.Log, logger *log.Entry) (deliver func() error, revert func() error, err error) {
+	if l.isAgentRegistry(le.Address) {
+		deliver, revert, err = l.handleAgentRegistryEvent(le, logger)
+	} else if l.isDispatcher(le.Address) {
+		deliver, revert, err = l.handleDispatcherEvent(le, logger)
+	} else if l.isScannerRegistry(le.Address) {
+		deliver, revert, err = l.handleScannerRegistryEvent(le, logger)
+	}
+	return instrumentDeliver(l.listenerLabel(), l.contractLabel(le.Address), eventNameForLog(le), deliver), revert, err
 }
 
+// eventNameForLog returns the forta_registry_logs_total "event" label for a
+// registry log, based on its topic.
+func eventNameForLog(le types.Log) string {
+	switch {
+	case isEvent(le, contract_scanner_registry.ScannerUpdatedTopic):
+		return "ScannerUpdated"
+	case isEvent(le, contract_scanner_registry.ScannerEnabledTopic):
+		return "ScannerEnabled"
+	case isEvent(le, contract_agent_registry.AgentUpdatedTopic):
+		return "AgentUpdated"
+	case isEvent(le, contract_agent_registry.AgentEnabledTopic):
+		return "AgentEnabled"
+	case isEvent(le, contract_dispatch.LinkTopic):
+		return "Link"
+	default:
+		return "unknown"
+	}
+}
+
+// handleLog routes a single log line. When blk is known (the live listening
+// path), the resulting event is buffered until its block is finalized; when
+// blk is nil (historical backfill via ProcessLastBlocks), the event is
+// already on a block deep enough to be treated as final and is delivered
+// immediately.
 func (l *listener) handleLog(blk *domain.Block, le types.Log) error {
 	if l.ctx.Err() != nil {
 		return l.ctx.Err()
 	}
 	logger := getLoggerForLog(le)
-	if l.isAgentRegistry(le.Address) {
-		return l.handleAgentRegistryEvent(le, logger)
+	deliver, revert, err := l.eventForLog(le, logger)
+	if err != nil || deliver == nil {
+		return err
 	}
-	if l.isDispatcher(le.Address) {
-		return l.handleDispatcherEvent(le, logger)
+	if blk == nil {
+		return deliver()
 	}
-	if l.isScannerRegistry(le.Address) {
-		return l.handleScannerRegistryEvent(le, logger)
+
+	number, err := utils.HexToBigInt(blk.Number)
+	if err != nil {
+		return err
 	}
+	fb := l.ring.getOrCreate(number.Uint64(), blk)
+	fb.events = append(fb.events, bufferedEvent{deliver: deliver, revert: revert})
 	return nil
 }
 
+// handleAfterBlock runs the AfterBlockHandler for the new block, then
+// promotes any previously buffered blocks that have reached finality.
 func (l *listener) handleAfterBlock(blk *domain.Block) error {
 	if l.ctx.Err() != nil {
 		return l.ctx.Err()
 	}
-	if l.cfg.Handlers.AfterBlockHandler != nil {
-		return l.cfg.Handlers.AfterBlockHandler(blk)
+	if err := l.bus.PublishAfterBlock(l.ctx, blk); err != nil {
+		return err
 	}
-	return nil
+	tip, err := utils.HexToBigInt(blk.Number)
+	if err != nil {
+		return err
+	}
+	l.recordTip(tip.Uint64())
+	return l.promoteFinalizedBlocks(tip.Uint64())
 }
 
-// ProcessLogs fetches the logs in a single pass and calls handlers for them
+// canonicalHashAt resolves the canonical block hash at number as currently
+// seen by the chain, used to detect reorgs of blocks still buffered awaiting
+// finality.
+func (l *listener) canonicalHashAt(number uint64) (string, error) {
+	blk, err := l.client.BlockByNumber(l.ctx, new(big.Int).SetUint64(number))
+	if err != nil {
+		return "", err
+	}
+	return blk.Hash, nil
+}
+
+// ProcessLastBlocks fetches the logs in a single pass and calls handlers for
+// them immediately, treating every log as already final. Suitable for
+// one-off backfills of old, settled history.
 func (l *listener) ProcessLastBlocks(blocksAgo int64) error {
 	logs, err := l.logs.GetLogsForLastBlocks(blocksAgo)
 	if err != nil {
@@ -164,6 +287,26 @@ func (l *listener) ProcessLastBlocks(blocksAgo int64) error {
 	return nil
 }
 
+// ProcessLastFinalizedBlocks is the ProcessLastBlocks counterpart that
+// guarantees every log it surfaces already sits behind the configured
+// finality boundary: it widens the lookback window by FinalityDepth blocks
+// on the start side, and - unlike ProcessLastBlocks, which always reads up
+// to the live tip - also caps the end of the range at FinalityDepth blocks
+// behind the tip, so a log from an unconfirmed, still reorg-able block is
+// never handed to handlers as if it were final.
+func (l *listener) ProcessLastFinalizedBlocks(blocksAgo int64) error {
+	logs, err := l.logs.GetLogsForBlockRange(blocksAgo+int64(l.finalityDepth), int64(l.finalityDepth))
+	if err != nil {
+		return err
+	}
+	for _, lg := range logs {
+		if err := l.handleLog(nil, lg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (l *listener) Listen() error {
 	return l.logs.ForEachLog(l.handleLog, l.handleAfterBlock)
 }
@@ -195,25 +338,51 @@ func NewListener(ctx context.Context, cfg ListenerConfig) (*listener, error) {
 		return nil, err
 	}
 
-	logFeed, err := feeds.NewLogFeed(ctx, client, feeds.LogFeedConfig{
-		Addresses:  []string{regContracts.AgentRegistry.Hex(), regContracts.ScannerRegistry.Hex(), regContracts.Dispatch.Hex()},
-		StartBlock: cfg.StartBlock,
-		Offset:     cfg.BlockOffset,
-	})
+	var lf logFeed
+	if cfg.FilterSystem != nil {
+		lf = newFilterSystemLogFeed(ctx, cfg.FilterSystem, []common.Address{
+			regContracts.AgentRegistry, regContracts.ScannerRegistry, regContracts.Dispatch,
+		}, cfg.StartBlock)
+	} else {
+		lf, err = feeds.NewLogFeed(ctx, client, feeds.LogFeedConfig{
+			Addresses:  []string{regContracts.AgentRegistry.Hex(), regContracts.ScannerRegistry.Hex(), regContracts.Dispatch.Hex()},
+			StartBlock: cfg.StartBlock,
+			Offset:     cfg.BlockOffset,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	finalityDepth := cfg.FinalityDepth
+	if finalityDepth <= 0 {
+		finalityDepth = DefaultFinalityDepth
+	}
 
-	if err != nil {
-		return nil, err
+	bus := cfg.EventBus
+	if bus == nil {
+		bus = NewEventBus(BusConfig{}).FromHandlers(cfg.Handlers)
+	}
+
+	metricsRegistry := cfg.MetricsRegistry
+	if metricsRegistry == nil {
+		metricsRegistry = health.Registry
 	}
+	registerMetrics(metricsRegistry)
 
 	return &listener{
 		ctx:              ctx,
 		cfg:              cfg,
-		logs:             logFeed,
+		logs:             lf,
+		client:           client,
 		scannerAddr:      regContracts.ScannerRegistry.Hex(),
 		agentAddr:        regContracts.AgentRegistry.Hex(),
 		dispatchAddr:     regContracts.Dispatch.Hex(),
 		scannerFilterer:  sf,
 		agentsFilterer:   af,
 		dispatchFilterer: df,
+		ring:             newBlockRing(),
+		finalityDepth:    finalityDepth,
+		bus:              bus,
 	}, nil
 }
@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+)
+
+// fakeLogFeed is a hand-rolled logFeed fake recording the range it was asked
+// for, used instead of a gomock fake since logFeed is a package-local
+// interface with no generated mock.
+type fakeLogFeed struct {
+	fromBlocksAgo, toBlocksAgo int64
+}
+
+func (f *fakeLogFeed) ForEachLog(handleLog func(blk *domain.Block, le types.Log) error, handleAfterBlock func(blk *domain.Block) error) error {
+	return nil
+}
+
+func (f *fakeLogFeed) GetLogsForLastBlocks(blocksAgo int64) ([]types.Log, error) {
+	return f.GetLogsForBlockRange(blocksAgo, 0)
+}
+
+func (f *fakeLogFeed) GetLogsForBlockRange(fromBlocksAgo, toBlocksAgo int64) ([]types.Log, error) {
+	f.fromBlocksAgo, f.toBlocksAgo = fromBlocksAgo, toBlocksAgo
+	return nil, nil
+}
+
+func TestProcessLastFinalizedBlocksCapsTheUpperEndOfTheRange(t *testing.T) {
+	logs := &fakeLogFeed{}
+	l := &listener{ctx: context.Background(), logs: logs, finalityDepth: 12}
+
+	require.NoError(t, l.ProcessLastFinalizedBlocks(100))
+
+	assert.Equal(t, int64(112), logs.fromBlocksAgo, "lower end widens by finalityDepth, same as before")
+	assert.Equal(t, int64(12), logs.toBlocksAgo, "upper end must stay finalityDepth behind the tip, not read all the way up to it")
+}
+
+func TestProcessLastBlocksReadsAllTheWayToTip(t *testing.T) {
+	logs := &fakeLogFeed{}
+	l := &listener{ctx: context.Background(), logs: logs}
+
+	require.NoError(t, l.ProcessLastBlocks(100))
+
+	assert.Equal(t, int64(100), logs.fromBlocksAgo)
+	assert.Equal(t, int64(0), logs.toBlocksAgo, "ProcessLastBlocks treats every log as final, so it reads up to the live tip")
+}
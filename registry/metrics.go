@@ -0,0 +1,107 @@
+package registry
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/forta-protocol/forta-core-go/clients/health"
+)
+
+var (
+	logsProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forta_registry_logs_total",
+		Help: "Number of registry contract logs processed, by listener, contract and event.",
+	}, []string{"listener", "contract", "event"})
+
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "forta_registry_handler_errors_total",
+		Help: "Number of errors returned by registry event handlers, by listener, contract and event.",
+	}, []string{"listener", "contract", "event"})
+
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "forta_registry_handler_duration_seconds",
+		Help: "Time spent in a registry event handler, by listener, contract and event.",
+	}, []string{"listener", "contract", "event"})
+
+	tipBlockNumber = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forta_registry_tip_block_number",
+		Help: "Block number of the last block the listener processed, by listener.",
+	}, []string{"listener"})
+
+	tipBlockLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "forta_registry_tip_block_lag",
+		Help: "Difference between eth_blockNumber and the last block the listener processed, by listener.",
+	}, []string{"listener"})
+)
+
+// registerMetrics registers the listener's collectors against registry. It is
+// called with cfg.MetricsRegistry by NewListener rather than from init(), so
+// a listener configured against a consumer-supplied registry (e.g. one also
+// passed to health.WithRegistry) actually exposes these metrics at that
+// registry's /metrics, instead of always landing on the package-level
+// health.Registry regardless of what the rest of the service uses.
+func registerMetrics(registry *prometheus.Registry) {
+	health.RegisterCollectorTo(registry, logsProcessed)
+	health.RegisterCollectorTo(registry, handlerErrors)
+	health.RegisterCollectorTo(registry, handlerDuration)
+	health.RegisterCollectorTo(registry, tipBlockNumber)
+	health.RegisterCollectorTo(registry, tipBlockLag)
+}
+
+// contractLabel returns the forta_registry_logs_total "contract" label for
+// the address a log came from.
+func (l *listener) contractLabel(address common.Address) string {
+	switch {
+	case l.isAgentRegistry(address):
+		return "agent"
+	case l.isScannerRegistry(address):
+		return "scanner"
+	case l.isDispatcher(address):
+		return "dispatch"
+	default:
+		return "unknown"
+	}
+}
+
+// listenerLabel returns the forta_registry_* "listener" label identifying
+// which configured listener recorded a given metric. Several listeners
+// (e.g. one per chain) can share a process and MetricsRegistry, and without
+// this label their counters/gauges would collide on the same series.
+func (l *listener) listenerLabel() string {
+	if l.cfg.Name == "" {
+		return "default"
+	}
+	return l.cfg.Name
+}
+
+// instrumentDeliver wraps a deliver closure so it updates the logs/errors/
+// duration metrics for listener, contract and event, without changing the
+// closure's observable behavior.
+func instrumentDeliver(listener, contract, event string, deliver func() error) func() error {
+	if deliver == nil {
+		return nil
+	}
+	return func() error {
+		logsProcessed.WithLabelValues(listener, contract, event).Inc()
+		start := time.Now()
+		err := deliver()
+		handlerDuration.WithLabelValues(listener, contract, event).Observe(time.Since(start).Seconds())
+		if err != nil {
+			handlerErrors.WithLabelValues(listener, contract, event).Inc()
+		}
+		return err
+	}
+}
+
+// recordTip updates the tip block number and lag-behind-chain-head gauges
+// for this listener.
+func (l *listener) recordTip(blockNumber uint64) {
+	tipBlockNumber.WithLabelValues(l.listenerLabel()).Set(float64(blockNumber))
+	head, err := l.client.BlockNumber(l.ctx)
+	if err != nil {
+		return
+	}
+	tipBlockLag.WithLabelValues(l.listenerLabel()).Set(float64(head.Uint64() - blockNumber))
+}
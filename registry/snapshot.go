@@ -0,0 +1,281 @@
+package registry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/goccy/go-json"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/forta-protocol/forta-core-go/domain"
+	"github.com/forta-protocol/forta-core-go/domain/registry"
+	"github.com/forta-protocol/forta-core-go/ens"
+	"github.com/forta-protocol/forta-core-go/utils"
+)
+
+// SnapshotSchemaVersion is bumped whenever the snapshot entity or manifest
+// shape changes in a way that isn't backward compatible.
+const SnapshotSchemaVersion = 1
+
+// SnapshotManifest describes a snapshot's provenance, so a Replayer can
+// refuse to load one taken against a different set of registry contracts
+// (Replayer.Load does not compare ChainID). It is always the last line of a
+// snapshot stream.
+type SnapshotManifest struct {
+	Type            string `json:"type"`
+	SchemaVersion   int    `json:"schemaVersion"`
+	ChainID         int64  `json:"chainId"`
+	AgentRegistry   string `json:"agentRegistry"`
+	ScannerRegistry string `json:"scannerRegistry"`
+	Dispatch        string `json:"dispatch"`
+	LastBlock       uint64 `json:"lastBlock"`
+	LastBlockHash   string `json:"lastBlockHash"`
+}
+
+// snapshotEntity is one streamed NDJSON line preceding the manifest.
+type snapshotEntity struct {
+	Type        string                       `json:"type"`
+	AgentSave   *registry.AgentSaveMessage   `json:"agentSave,omitempty"`
+	ScannerSave *registry.ScannerSaveMessage `json:"scannerSave,omitempty"`
+	Dispatch    *registry.DispatchMessage    `json:"dispatch,omitempty"`
+}
+
+// SnapshotStore persists and loads named snapshot streams.
+type SnapshotStore interface {
+	Write(ctx context.Context, name string) (io.WriteCloser, error)
+	Read(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// Snapshotter subscribes to an EventBus and periodically serializes the
+// cumulative registry state implied by the events it has seen into a
+// SnapshotStore, so a new consumer can start from the latest snapshot
+// instead of re-scanning from genesis.
+type Snapshotter struct {
+	store    SnapshotStore
+	name     string
+	interval time.Duration
+
+	mu       sync.Mutex
+	manifest SnapshotManifest
+	agents   map[string]*registry.AgentSaveMessage
+	scanners map[string]*registry.ScannerSaveMessage
+	dispatch []*registry.DispatchMessage
+}
+
+// NewSnapshotter subscribes to bus and writes to store under name every
+// interval, until ctx is canceled. manifest should have ChainID and the
+// registry contract addresses pre-filled; LastBlock/LastBlockHash are kept
+// current by subscribing to TopicAfterBlock.
+func NewSnapshotter(ctx context.Context, bus *EventBus, store SnapshotStore, name string, manifest SnapshotManifest, interval time.Duration) *Snapshotter {
+	s := &Snapshotter{
+		store:    store,
+		name:     name,
+		interval: interval,
+		manifest: manifest,
+		agents:   make(map[string]*registry.AgentSaveMessage),
+		scanners: make(map[string]*registry.ScannerSaveMessage),
+	}
+
+	bus.SubscribeAgentSave(func(ctx context.Context, logger *log.Entry, msg *registry.AgentSaveMessage) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.agents[msg.AgentID] = msg
+		return nil
+	})
+	bus.SubscribeScannerSave(func(ctx context.Context, logger *log.Entry, msg *registry.ScannerSaveMessage) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.scanners[msg.ScannerID] = msg
+		return nil
+	})
+	bus.SubscribeDispatch(func(ctx context.Context, logger *log.Entry, msg *registry.DispatchMessage) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.dispatch = append(s.dispatch, msg)
+		return nil
+	})
+	bus.SubscribeAfterBlock(func(ctx context.Context, blk *domain.Block) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if num, err := utils.HexToBigInt(blk.Number); err == nil {
+			s.manifest.LastBlock = num.Uint64()
+		}
+		s.manifest.LastBlockHash = blk.Hash
+		return nil
+	})
+
+	go s.run(ctx)
+	return s
+}
+
+func (s *Snapshotter) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(ctx); err != nil {
+				log.WithError(err).Warn("snapshotter: failed to write snapshot")
+			}
+		}
+	}
+}
+
+// Snapshot writes the current cumulative state to the store immediately,
+// instead of waiting for the next tick.
+func (s *Snapshotter) Snapshot(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, err := s.store.Write(ctx, s.name)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	enc := json.NewEncoder(w)
+	for _, msg := range s.agents {
+		if err := enc.Encode(snapshotEntity{Type: "agentSave", AgentSave: msg}); err != nil {
+			return err
+		}
+	}
+	for _, msg := range s.scanners {
+		if err := enc.Encode(snapshotEntity{Type: "scannerSave", ScannerSave: msg}); err != nil {
+			return err
+		}
+	}
+	for _, msg := range s.dispatch {
+		if err := enc.Encode(snapshotEntity{Type: "dispatch", Dispatch: msg}); err != nil {
+			return err
+		}
+	}
+
+	manifest := s.manifest
+	manifest.Type = "manifest"
+	manifest.SchemaVersion = SnapshotSchemaVersion
+	return enc.Encode(manifest)
+}
+
+// Replayer loads a snapshot written by Snapshotter and replays it onto an
+// EventBus, so a Listener built with NewListenerFromSnapshot can catch up
+// without re-scanning from genesis.
+type Replayer struct {
+	store SnapshotStore
+}
+
+// NewReplayer creates a Replayer reading snapshots from store.
+func NewReplayer(store SnapshotStore) *Replayer {
+	return &Replayer{store: store}
+}
+
+// Load streams name from the store, publishes every entity in it to bus
+// (each marked as replayed), and returns the manifest. The snapshot's
+// contract addresses are checked against agentRegistry/scannerRegistry/
+// dispatch - normally resolved moments earlier by the current ens.Store - so
+// a snapshot taken against a different environment is rejected rather than
+// silently corrupting state.
+func (r *Replayer) Load(ctx context.Context, name string, agentRegistry, scannerRegistry, dispatch common.Address, bus *EventBus) (*SnapshotManifest, error) {
+	rc, err := r.store.Read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var manifest SnapshotManifest
+	var entities []snapshotEntity
+
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var probe struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(line, &probe); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot line: %v", err)
+		}
+		if probe.Type == "manifest" {
+			if err := json.Unmarshal(line, &manifest); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var entity snapshotEntity
+		if err := json.Unmarshal(line, &entity); err != nil {
+			return nil, err
+		}
+		entities = append(entities, entity)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if manifest.SchemaVersion != SnapshotSchemaVersion {
+		return nil, fmt.Errorf("refusing to replay snapshot %q: schema version %d does not match the version this Replayer understands (%d)", name, manifest.SchemaVersion, SnapshotSchemaVersion)
+	}
+
+	if manifest.AgentRegistry != agentRegistry.Hex() ||
+		manifest.ScannerRegistry != scannerRegistry.Hex() ||
+		manifest.Dispatch != dispatch.Hex() {
+		return nil, fmt.Errorf("refusing to replay snapshot %q: contract addresses do not match the resolved registry", name)
+	}
+
+	replayedLogger := log.WithField("replayed", true)
+	for _, entity := range entities {
+		switch entity.Type {
+		case "agentSave":
+			entity.AgentSave.Replayed = true
+			if err := bus.PublishAgentSave(ctx, replayedLogger, entity.AgentSave); err != nil {
+				return nil, err
+			}
+		case "scannerSave":
+			entity.ScannerSave.Replayed = true
+			if err := bus.PublishScannerSave(ctx, replayedLogger, entity.ScannerSave); err != nil {
+				return nil, err
+			}
+		case "dispatch":
+			entity.Dispatch.Replayed = true
+			if err := bus.PublishDispatch(ctx, replayedLogger, entity.Dispatch); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &manifest, nil
+}
+
+// NewListenerFromSnapshot builds a Listener the same way as NewListener, but
+// first replays the named snapshot onto cfg's event bus (building one from
+// cfg.Handlers if cfg.EventBus is unset) and resumes live processing from
+// snapshot.LastBlock+1 instead of cfg.StartBlock.
+func NewListenerFromSnapshot(ctx context.Context, cfg ListenerConfig, store SnapshotStore, snapshotName string) (*listener, error) {
+	ensStore, err := ens.DialENSStoreAt(cfg.JsonRpcURL, cfg.ENSAddress)
+	if err != nil {
+		return nil, err
+	}
+	regContracts, err := ensStore.ResolveRegistryContracts()
+	if err != nil {
+		return nil, err
+	}
+
+	bus := cfg.EventBus
+	if bus == nil {
+		bus = NewEventBus(BusConfig{}).FromHandlers(cfg.Handlers)
+	}
+
+	manifest, err := NewReplayer(store).Load(ctx, snapshotName, regContracts.AgentRegistry, regContracts.ScannerRegistry, regContracts.Dispatch, bus)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.EventBus = bus
+	cfg.StartBlock = new(big.Int).SetUint64(manifest.LastBlock + 1)
+	return NewListener(ctx, cfg)
+}
@@ -0,0 +1,81 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FilesystemSnapshotStore stores snapshots as files under a directory.
+type FilesystemSnapshotStore struct {
+	dir string
+}
+
+// NewFilesystemSnapshotStore creates a FilesystemSnapshotStore rooted at dir.
+// dir must already exist.
+func NewFilesystemSnapshotStore(dir string) *FilesystemSnapshotStore {
+	return &FilesystemSnapshotStore{dir: dir}
+}
+
+// Write implements SnapshotStore.
+func (s *FilesystemSnapshotStore) Write(ctx context.Context, name string) (io.WriteCloser, error) {
+	return os.Create(filepath.Join(s.dir, name))
+}
+
+// Read implements SnapshotStore.
+func (s *FilesystemSnapshotStore) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, name))
+}
+
+// S3API is a deliberately simplified put/get interface S3SnapshotStore needs.
+// It is not satisfied by *s3.Client from aws-sdk-go-v2 - that SDK's
+// PutObject/GetObject take *s3.PutObjectInput/*s3.GetObjectInput and
+// functional options, not these bucket/key/body arguments - so wiring up a
+// real S3 client means writing a small adapter that implements S3API in
+// terms of the SDK's actual calls.
+type S3API interface {
+	PutObject(ctx context.Context, bucket, key string, body io.Reader) error
+	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+}
+
+// S3SnapshotStore stores snapshots as objects in an S3-compatible bucket,
+// under prefix+name.
+type S3SnapshotStore struct {
+	api    S3API
+	bucket string
+	prefix string
+}
+
+// NewS3SnapshotStore creates an S3SnapshotStore backed by api.
+func NewS3SnapshotStore(api S3API, bucket, prefix string) *S3SnapshotStore {
+	return &S3SnapshotStore{api: api, bucket: bucket, prefix: prefix}
+}
+
+// Write implements SnapshotStore. The snapshot is buffered in memory and
+// uploaded as a single object on Close, since S3's PutObject API needs to
+// know the body up front.
+func (s *S3SnapshotStore) Write(ctx context.Context, name string) (io.WriteCloser, error) {
+	return &s3Writer{ctx: ctx, api: s.api, bucket: s.bucket, key: s.prefix + name}, nil
+}
+
+// Read implements SnapshotStore.
+func (s *S3SnapshotStore) Read(ctx context.Context, name string) (io.ReadCloser, error) {
+	return s.api.GetObject(ctx, s.bucket, s.prefix+name)
+}
+
+type s3Writer struct {
+	ctx         context.Context
+	api         S3API
+	bucket, key string
+	buf         bytes.Buffer
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *s3Writer) Close() error {
+	return w.api.PutObject(w.ctx, w.bucket, w.key, &w.buf)
+}